@@ -0,0 +1,174 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cacheRootDir, hashFileContents and lookupCachedDiagnostics go through the
+// Fs passed to them (OsFs in production, MemMapFs in tests) so the rule-check
+// read path stays testable end to end. storeCachedDiagnostics, clearCache
+// and gcCacheOlderThan write and remove files, which Fs has no methods for,
+// so they stay hard-wired to OsFs.
+
+/**************************************************************************/
+
+// Content-addressable diagnostic cache.
+//
+// Results are cached under .git/git-sanity-checker/cache, sharded by the
+// first two hex characters of the key (like buildkit's contenthash cache),
+// keyed by sha256(file contents) || sha256(rules config) || sha256(resolved
+// rule set). Editing git-sanity-checker.cfg therefore invalidates every
+// cached entry, as does an include/exclude/extension filter resolving to a
+// different rule set for that file (see resolvedRuleSetFingerprint).
+//
+// The key intentionally excludes the file path, so two files with identical
+// contents and the same resolved rule set share one entry; callers must not
+// persist the checked file's path as part of the cached payload (see
+// stripDiagnosticPaths) and must re-stamp it from the current file on every
+// cache hit.
+
+const (
+	cacheDirName    = "git-sanity-checker"
+	cacheSubDirName = "cache"
+	cacheMaxAgeDays = 30
+)
+
+// noCacheMode disables cache reads and writes for this run when --no-cache
+// is passed.
+var noCacheMode = false
+
+// cacheMutex guards the on-disk cache against concurrent reads and writes
+// from the runRulesOnFiles worker pool.
+var cacheMutex sync.Mutex
+
+func cacheRootDir(fs Fs) (string, bool) {
+	repoRoot, ok := findRepoRootDir(fs)
+	if !ok {
+		return "", false
+	}
+	return filepath.Join(repoRoot, ".git", cacheDirName, cacheSubDirName), true
+}
+
+func hashFileContents(fs Fs, filePath string) (string, error) {
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+func hashString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+func configFileFingerprint() string {
+	return hashString(readFileString(configFilePath()))
+}
+
+func cacheEntryKey(fileHash string, configHash string, ruleSetHash string) string {
+	return hashString(fileHash + "|" + configHash + "|" + ruleSetHash)
+}
+
+func cacheEntryPath(root string, key string) string {
+	return filepath.Join(root, key[0:2], key[2:])
+}
+
+// lookupCachedDiagnostics returns the cache key to use for storing the
+// result (empty if caching is unavailable), the cached diagnostics text,
+// and whether the lookup was a hit. ruleSetHash must fingerprint the rules
+// that actually apply to filePath, so two files sharing file contents but
+// resolving to different rule sets (e.g. via include/exclude globs) never
+// share an entry.
+func lookupCachedDiagnostics(fs Fs, filePath string, configHash string, ruleSetHash string) (key string, diagnostics string, hit bool) {
+	if noCacheMode {
+		return "", "", false
+	}
+
+	root, ok := cacheRootDir(fs)
+	if !ok {
+		return "", "", false
+	}
+
+	fileHash, err := hashFileContents(fs, filePath)
+	if err != nil {
+		return "", "", false
+	}
+
+	key = cacheEntryKey(fileHash, configHash, ruleSetHash)
+
+	cacheMutex.Lock()
+	data, err := fs.ReadFile(cacheEntryPath(root, key))
+	cacheMutex.Unlock()
+	if err != nil {
+		return key, "", false
+	}
+	return key, string(data), true
+}
+
+func storeCachedDiagnostics(key string, diagnostics string) {
+	if noCacheMode || key == "" {
+		return
+	}
+
+	root, ok := cacheRootDir(OsFs{})
+	if !ok {
+		return
+	}
+
+	entryPath := cacheEntryPath(root, key)
+
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(entryPath), 0755); err != nil {
+		return
+	}
+	ioutil.WriteFile(entryPath, []byte(diagnostics), 0644)
+}
+
+func clearCache() {
+	root, ok := cacheRootDir(OsFs{})
+	if !ok {
+		return
+	}
+	os.RemoveAll(root)
+}
+
+// gcCacheOlderThan deletes cache entries that have not been written in
+// maxAgeDays days.
+func gcCacheOlderThan(maxAgeDays int) {
+	root, ok := cacheRootDir(OsFs{})
+	if !ok {
+		return
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -maxAgeDays)
+
+	filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info == nil || info.IsDir() {
+			return nil
+		}
+		if info.ModTime().Before(cutoff) {
+			os.Remove(p)
+		}
+		return nil
+	})
+}
+
+/**************************************************************************/
+
+// End.
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+/**************************************************************************/
+
+// Autofix.
+
+// applyFixes rewrites each file in place by running every fixable rule
+// against it in sequence, then re-checks the result to confirm it is clean.
+func applyFixes(rules []rule, files []string) {
+	ignorePatterns := loadGitSanityIgnore(OsFs{})
+	for _, filePath := range files {
+		if isIgnoredByGitSanityIgnore(ignorePatterns, relativePathForGlob(OsFs{}, filePath)) {
+			continue
+		}
+		fixFile(rules, filePath, false)
+	}
+}
+
+// printFixDiffs runs the same fixes as applyFixes but only prints a unified
+// diff of what would change, without writing anything to disk.
+func printFixDiffs(rules []rule, files []string) {
+	ignorePatterns := loadGitSanityIgnore(OsFs{})
+	for _, filePath := range files {
+		if isIgnoredByGitSanityIgnore(ignorePatterns, relativePathForGlob(OsFs{}, filePath)) {
+			continue
+		}
+		fixFile(rules, filePath, true)
+	}
+}
+
+func fixFile(rules []rule, filePath string, diffOnly bool) {
+	canonicalPath := getCanonicalPath(filePath)
+	fileExtension := filepath.Ext(canonicalPath)
+	relPath := relativePathForGlob(OsFs{}, canonicalPath)
+
+	firstNChars, err := readFirstNCharsFs(OsFs{}, canonicalPath, 50)
+	if err != nil {
+		fatal(err.Error())
+	}
+	isBinary := hasControlCharacters(firstNChars)
+
+	original := readFileString(canonicalPath)
+	current := original
+	changedAny := false
+
+	// Apply each fixer sequentially against fresh line arrays, so later
+	// fixers see the edits made by earlier ones.
+	for _, r := range rules {
+		if r.fixFunc == nil {
+			continue
+		}
+		if len(r.fileExtensions) != 0 && !stringArrayContains(r.fileExtensions, fileExtension) {
+			continue
+		}
+		if len(r.includeGlobs) != 0 && !matchAnyGlob(r.includeGlobs, relPath) {
+			continue
+		}
+		if len(r.excludeGlobs) != 0 && matchAnyGlob(r.excludeGlobs, relPath) {
+			continue
+		}
+		if isBinary && (r.fileTypeFlags&flagBinaryFile == 0) {
+			continue
+		}
+		if !isBinary && (r.fileTypeFlags&flagTextFile == 0) {
+			continue
+		}
+
+		fixed, changed := r.fixFunc(ruleCheckArgs{
+			fs:           OsFs{},
+			filePath:     canonicalPath,
+			fileAsString: current,
+			fileAsLines:  convertStringToLines(current, false),
+			argument:     r.argument,
+		})
+		if changed {
+			current = fixed
+			changedAny = true
+		}
+	}
+
+	if !changedAny {
+		return
+	}
+
+	if diffOnly {
+		fmt.Print(unifiedDiff(filePath, original, current))
+		return
+	}
+
+	if err := writeFileAtomic(canonicalPath, current); err != nil {
+		fatal("Cannot write file " + canonicalPath + ": " + err.Error())
+	}
+
+	// Re-run the checks to confirm the file is now clean.
+	runRulesOnFiles(OsFs{}, rules, []string{canonicalPath}, 1)
+}
+
+// writeFileAtomic writes newContents to filePath via a temp file plus
+// rename, preserving the original file's mode.
+func writeFileAtomic(filePath string, newContents string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(filePath), filepath.Base(filePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	if _, err := tempFile.WriteString(newContents); err != nil {
+		tempFile.Close()
+		os.Remove(tempPath)
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	if err := os.Chmod(tempPath, info.Mode()); err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return os.Rename(tempPath, filePath)
+}
+
+// unifiedDiff shells out to the system "diff" tool, the same way the rest of
+// this file shells out to "git", and relabels the temp paths as filePath.
+func unifiedDiff(filePath string, before string, after string) string {
+	beforeFile, err := ioutil.TempFile("", "git-sanity-checker-before")
+	if err != nil {
+		fatal(err.Error())
+	}
+	defer os.Remove(beforeFile.Name())
+	beforeFile.WriteString(before)
+	beforeFile.Close()
+
+	afterFile, err := ioutil.TempFile("", "git-sanity-checker-after")
+	if err != nil {
+		fatal(err.Error())
+	}
+	defer os.Remove(afterFile.Name())
+	afterFile.WriteString(after)
+	afterFile.Close()
+
+	cmd := exec.Command("diff", "-u", beforeFile.Name(), afterFile.Name())
+	output, _ := cmd.CombinedOutput()
+
+	diff := string(output)
+	diff = strings.Replace(diff, beforeFile.Name(), filePath+".orig", 1)
+	diff = strings.Replace(diff, afterFile.Name(), filePath, 1)
+	return diff
+}
+
+/**************************************************************************/
+
+// Fixers.
+
+const fixedTabWidth = 4
+
+func fixNoTabs(args ruleCheckArgs) (string, bool) {
+	if !strings.ContainsRune(args.fileAsString, '\t') {
+		return args.fileAsString, false
+	}
+	return strings.Replace(args.fileAsString, "\t", strings.Repeat(" ", fixedTabWidth), -1), true
+}
+
+func fixNoLeadingSpaces(args ruleCheckArgs) (string, bool) {
+	return mapLines(args.fileAsString, func(line string) string {
+		return strings.TrimLeft(line, " ")
+	})
+}
+
+func fixConsistentNewlines(args ruleCheckArgs) (string, bool) {
+	return normalizeNewlines(args.fileAsString, "\n")
+}
+
+func fixWindowsNewlines(args ruleCheckArgs) (string, bool) {
+	return normalizeNewlines(args.fileAsString, "\r\n")
+}
+
+func fixLinuxNewlines(args ruleCheckArgs) (string, bool) {
+	return normalizeNewlines(args.fileAsString, "\n")
+}
+
+func fixOldMacNewlines(args ruleCheckArgs) (string, bool) {
+	return normalizeNewlines(args.fileAsString, "\r")
+}
+
+func fixNeedSpaceAfterKeyword(args ruleCheckArgs) (string, bool) {
+	return mapLines(args.fileAsString, func(line string) string {
+		indentLen := len(line) - len(strings.TrimLeft(line, " \t"))
+		indent := line[0:indentLen]
+		rest := line[indentLen:]
+
+		for _, keyword := range csharpKeywordsWithSpacedParens {
+			if strings.HasPrefix(rest, keyword+"(") {
+				return indent + keyword + " (" + rest[len(keyword)+1:]
+			}
+		}
+		return line
+	})
+}
+
+// normalizeNewlines rewrites every line ending in s to targetNewline.
+func normalizeNewlines(s string, targetNewline string) (string, bool) {
+	normalized := strings.Replace(s, "\r\n", "\n", -1)
+	normalized = strings.Replace(normalized, "\r", "\n", -1)
+	if targetNewline != "\n" {
+		normalized = strings.Replace(normalized, "\n", targetNewline, -1)
+	}
+	return normalized, normalized != s
+}
+
+// mapLines applies transform to every line of s while preserving each
+// line's original terminator ("\n", "\r\n", or none for a final partial
+// line), and reports whether any line actually changed.
+func mapLines(s string, transform func(string) string) (string, bool) {
+	changed := false
+	var buffer bytes.Buffer
+	start := 0
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\n' {
+			continue
+		}
+
+		lineEnd := i
+		terminator := "\n"
+		if lineEnd > start && s[lineEnd-1] == '\r' {
+			lineEnd--
+			terminator = "\r\n"
+		}
+
+		line := s[start:lineEnd]
+		newLine := transform(line)
+		if newLine != line {
+			changed = true
+		}
+
+		buffer.WriteString(newLine)
+		buffer.WriteString(terminator)
+		start = i + 1
+	}
+
+	if start < len(s) {
+		line := s[start:]
+		newLine := transform(line)
+		if newLine != line {
+			changed = true
+		}
+		buffer.WriteString(newLine)
+	}
+
+	return buffer.String(), changed
+}
+
+/**************************************************************************/
+
+// End.
@@ -0,0 +1,90 @@
+package main
+
+import "testing"
+
+func TestFixNoTabs(t *testing.T) {
+	got, changed := fixNoTabs(ruleCheckArgs{fileAsString: "line one\n\tline two\n"})
+	want := "line one\n    line two\n"
+	if !changed || got != want {
+		t.Errorf("fixNoTabs: got (%q, %v), want (%q, true)", got, changed, want)
+	}
+
+	got, changed = fixNoTabs(ruleCheckArgs{fileAsString: "no tabs here\n"})
+	if changed || got != "no tabs here\n" {
+		t.Errorf("fixNoTabs on clean input: got (%q, %v), want unchanged", got, changed)
+	}
+}
+
+func TestFixNoLeadingSpaces(t *testing.T) {
+	got, changed := fixNoLeadingSpaces(ruleCheckArgs{fileAsString: "line one\n  line two\n"})
+	want := "line one\nline two\n"
+	if !changed || got != want {
+		t.Errorf("fixNoLeadingSpaces: got (%q, %v), want (%q, true)", got, changed, want)
+	}
+}
+
+func TestFixNeedSpaceAfterKeyword(t *testing.T) {
+	got, changed := fixNeedSpaceAfterKeyword(ruleCheckArgs{fileAsString: "void Method()\n{\n    if(x)\n    {\n    }\n}\n"})
+	want := "void Method()\n{\n    if (x)\n    {\n    }\n}\n"
+	if !changed || got != want {
+		t.Errorf("fixNeedSpaceAfterKeyword: got (%q, %v), want (%q, true)", got, changed, want)
+	}
+}
+
+func TestNormalizeNewlines(t *testing.T) {
+	cases := []struct {
+		name          string
+		s             string
+		targetNewline string
+		want          string
+		wantChanged   bool
+	}{
+		{
+			name:          "mixed to linux",
+			s:             "line1\r\nline2\nline3\r",
+			targetNewline: "\n",
+			want:          "line1\nline2\nline3\n",
+			wantChanged:   true,
+		},
+		{
+			name:          "linux to windows",
+			s:             "line1\nline2\n",
+			targetNewline: "\r\n",
+			want:          "line1\r\nline2\r\n",
+			wantChanged:   true,
+		},
+		{
+			name:          "already normalized",
+			s:             "line1\nline2\n",
+			targetNewline: "\n",
+			want:          "line1\nline2\n",
+			wantChanged:   false,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			got, changed := normalizeNewlines(c.s, c.targetNewline)
+			if got != c.want || changed != c.wantChanged {
+				t.Errorf("normalizeNewlines(%q, %q) = (%q, %v), want (%q, %v)", c.s, c.targetNewline, got, changed, c.want, c.wantChanged)
+			}
+		})
+	}
+}
+
+func TestMapLines(t *testing.T) {
+	upper := func(line string) string { return line + "!" }
+
+	got, changed := mapLines("a\r\nb\nc", upper)
+	want := "a!\r\nb!\nc!"
+	if !changed || got != want {
+		t.Errorf("mapLines: got (%q, %v), want (%q, true)", got, changed, want)
+	}
+
+	identity := func(line string) string { return line }
+	got, changed = mapLines("a\nb\n", identity)
+	if changed || got != "a\nb\n" {
+		t.Errorf("mapLines with no-op transform: got (%q, %v), want unchanged", got, changed)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**************************************************************************/
+
+// Fs abstraction.
+//
+// Fs is modeled on spf13/afero: it lets the file-discovery, config-loading
+// and rule-checking code be driven against an in-memory filesystem in
+// tests, instead of always touching the real one.
+
+// File is the subset of *os.File that rule checks need.
+type File interface {
+	io.ReadCloser
+}
+
+// Fs is implemented by OsFs for production use and by MemMapFs for tests.
+type Fs interface {
+	Open(name string) (File, error)
+	Stat(name string) (os.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Chdir(name string) error
+	Getwd() (string, error)
+}
+
+/**************************************************************************/
+
+// OsFs: the production Fs, backed directly by the os and ioutil packages.
+
+type OsFs struct{}
+
+func (OsFs) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (OsFs) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OsFs) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (OsFs) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (OsFs) Chdir(name string) error {
+	return os.Chdir(name)
+}
+
+func (OsFs) Getwd() (string, error) {
+	return os.Getwd()
+}
+
+/**************************************************************************/
+
+// MemMapFs: an in-memory Fs for tests, backed by a flat map of cleaned path
+// to contents. Directories are implied by file paths and are never stored
+// explicitly.
+
+type memFileInfo struct {
+	name  string
+	size  int64
+	isDir bool
+}
+
+func (i memFileInfo) Name() string { return i.name }
+func (i memFileInfo) Size() int64  { return i.size }
+
+func (i memFileInfo) Mode() os.FileMode {
+	if i.isDir {
+		return os.ModeDir | 0755
+	}
+	return 0644
+}
+
+func (i memFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memFileInfo) IsDir() bool        { return i.isDir }
+func (i memFileInfo) Sys() interface{}   { return nil }
+
+type memFile struct {
+	*bytes.Reader
+}
+
+func (memFile) Close() error { return nil }
+
+// MemMapFs is an in-memory Fs, safe for concurrent use.
+type MemMapFs struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	cwd   string
+}
+
+func NewMemMapFs() *MemMapFs {
+	return &MemMapFs{files: map[string][]byte{}, cwd: "/"}
+}
+
+// WriteFile adds or replaces a file's contents. It is a test helper, not
+// part of the Fs interface, since production code never creates files
+// through Fs.
+func (fs *MemMapFs) WriteFile(name string, contents string) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.files[filepath.Clean(name)] = []byte(contents)
+}
+
+func (fs *MemMapFs) Open(name string) (File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, ok := fs.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return memFile{bytes.NewReader(data)}, nil
+}
+
+func (fs *MemMapFs) Stat(name string) (os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if data, ok := fs.files[name]; ok {
+		return memFileInfo{name: filepath.Base(name), size: int64(len(data))}, nil
+	}
+	if fs.hasDirLocked(name) {
+		return memFileInfo{name: filepath.Base(name), isDir: true}, nil
+	}
+	return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+}
+
+func (fs *MemMapFs) hasDirLocked(dir string) bool {
+	prefix := dir
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	for p := range fs.files {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fs *MemMapFs) ReadFile(name string) ([]byte, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	data, ok := fs.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	return data, nil
+}
+
+func (fs *MemMapFs) ReadDir(name string) ([]os.FileInfo, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	prefix := filepath.Clean(name)
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	seenDirs := map[string]bool{}
+	var infos []os.FileInfo
+	for p, data := range fs.files {
+		if !strings.HasPrefix(p, prefix) {
+			continue
+		}
+
+		rest := p[len(prefix):]
+		if slash := strings.IndexByte(rest, '/'); slash >= 0 {
+			childDir := rest[0:slash]
+			if !seenDirs[childDir] {
+				seenDirs[childDir] = true
+				infos = append(infos, memFileInfo{name: childDir, isDir: true})
+			}
+			continue
+		}
+
+		infos = append(infos, memFileInfo{name: rest, size: int64(len(data))})
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (fs *MemMapFs) Chdir(name string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	fs.cwd = filepath.Clean(name)
+	return nil
+}
+
+func (fs *MemMapFs) Getwd() (string, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	return fs.cwd, nil
+}
+
+/**************************************************************************/
+
+// End.
@@ -22,7 +22,8 @@ package main
 
 import (
 	"bufio"
-	"bytes"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/kardianos/osext"
 	"io/ioutil"
@@ -30,9 +31,10 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"runtime"
 	"sort"
-	"strconv"
 	"strings"
+	"sync"
 )
 
 /**************************************************************************/
@@ -40,19 +42,31 @@ import (
 // Types.
 
 type ruleCheckArgs struct {
+	fs           Fs
 	filePath     string
 	fileAsString string
 	fileAsLines  []string
+	argument     string
+	ruleName     string
 }
 
-type checkFuncType func(args ruleCheckArgs) string
+// checkFuncType returns one Diagnostic per violation found, or nil if the
+// file is clean.
+type checkFuncType func(args ruleCheckArgs) []Diagnostic
+
+// fixFuncType returns the corrected file contents and whether a fix was
+// actually applied. Rules that cannot be auto-corrected leave fixFunc nil.
+type fixFuncType func(args ruleCheckArgs) (fixed string, changed bool)
 
 type rule struct {
 	name           string
 	argument       string
 	fileTypeFlags  int
 	fileExtensions []string
+	includeGlobs   []string
+	excludeGlobs   []string
 	checkFunc      checkFuncType
+	fixFunc        fixFuncType
 }
 
 /**************************************************************************/
@@ -119,21 +133,6 @@ func readFileString(filePath string) string {
 	return string(bytes)
 }
 
-func readFileLines(filePath string) []string {
-	file, err := os.Open(filePath)
-	if err != nil {
-		fatal("Cannot read file \"" + filePath + "\": " + err.Error())
-	}
-	defer file.Close()
-
-	var lines []string
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		lines = append(lines, scanner.Text())
-	}
-	return lines
-}
-
 func execAndGetOutput(command string, args []string) string {
 	cmd := exec.Command(command, args...)
 	output, err := cmd.CombinedOutput()
@@ -165,16 +164,29 @@ func convertStringToLines(s string, returnNonEmptyOnly bool) []string {
 	return nonEmptyLines
 }
 
-func readFirstNChars(filePath string, bytesCount int) string {
-	file, err := os.Open(filePath)
+// readFileStringFs and readFirstNCharsFs are the Fs-backed, error-returning
+// counterparts of readFileString and readFirstNChars, for use on the
+// runRulesOnFiles hot path: they go through the Fs passed in (OsFs in
+// production, MemMapFs in tests) and return an error instead of calling
+// fatal, so one bad file doesn't take down the whole worker pool.
+func readFileStringFs(fs Fs, filePath string) (string, error) {
+	data, err := fs.ReadFile(filePath)
 	if err != nil {
-		fatal("Cannot read file \"" + filePath + "\": " + err.Error())
+		return "", errors.New("Cannot read file " + filePath + ": " + err.Error())
+	}
+	return string(data), nil
+}
+
+func readFirstNCharsFs(fs Fs, filePath string, bytesCount int) (string, error) {
+	file, err := fs.Open(filePath)
+	if err != nil {
+		return "", errors.New("Cannot read file \"" + filePath + "\": " + err.Error())
 	}
 	defer file.Close()
 
 	bytes := make([]byte, bytesCount)
-	file.Read(bytes)
-	return string(bytes)
+	n, _ := file.Read(bytes)
+	return string(bytes[0:n]), nil
 }
 
 func isControlCharacter(char rune) bool {
@@ -218,10 +230,26 @@ func stringArrayReverse(array []string) {
 
 // Config.
 
-func loadConfigFile() []rule {
+func configFilePath() string {
 	cwd := getScriptDirectory()
-	configFilePath := path.Join(cwd, configFileName)
-	lines := readFileLines(configFilePath)
+	return path.Join(cwd, configFileName)
+}
+
+func loadConfigFile(fs Fs) []rule {
+	configFilePath := configFilePath()
+
+	file, err := fs.Open(configFilePath)
+	if err != nil {
+		fatal("Cannot read file \"" + configFilePath + "\": " + err.Error())
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
 	rules := parseConfigRules(configFilePath, lines)
 	return rules
 }
@@ -251,26 +279,28 @@ func parseConfigRules(configFilePath string, lines []string) []rule {
 func initRulesDefinitions() map[string]rule {
 	defs := make(map[string]rule)
 
-	addRule(defs, "DoNothing", ruleCheckDoNothing, flagTextFile, "")
-	addRule(defs, "NoTabs", ruleCheckNoTabs, flagTextFile, "")
-	addRule(defs, "NoLeadingSpaces", ruleCheckNoLeadingSpaces, flagTextFile, "")
-	addRule(defs, "TabsVsSpacesOnly", ruleCheckTabsVsSpacesOnly, flagTextFile, "")
-	addRule(defs, "ConsistentNewlines", ruleCheckConsistentNewlines, flagTextFile, "")
-	addRule(defs, "ConsistentIndentWidth", ruleCheckConsistentIndentWidth, flagTextFile, "")
-	addRule(defs, "BadNameSpace", ruleCheckBadNameSpace, flagTextFile, ".cs")
-	addRule(defs, "BadClassName", ruleCheckBadClassName, flagTextFile, ".cs")
-	addRule(defs, "NoMultiplePublicClasses", ruleCheckNoMultiplePublicClasses, flagTextFile, ".cs")
-	addRule(defs, "WindowsNewlines", ruleCheckWindowsNewlines, flagTextFile, "")
-	addRule(defs, "LinuxNewlines", ruleCheckLinuxNewlines, flagTextFile, "")
-	addRule(defs, "OldMacNewlines", ruleCheckOldMacNewlines, flagTextFile, "")
-	addRule(defs, "NeedSpaceAfterKeyword", ruleCheckNeedSpaceAfterKeyword, flagTextFile, ".cs")
+	addRule(defs, "DoNothing", ruleCheckDoNothing, nil, flagTextFile, "")
+	addRule(defs, "NoTabs", ruleCheckNoTabs, fixNoTabs, flagTextFile, "")
+	addRule(defs, "NoLeadingSpaces", ruleCheckNoLeadingSpaces, fixNoLeadingSpaces, flagTextFile, "")
+	addRule(defs, "TabsVsSpacesOnly", ruleCheckTabsVsSpacesOnly, nil, flagTextFile, "")
+	addRule(defs, "ConsistentNewlines", ruleCheckConsistentNewlines, fixConsistentNewlines, flagTextFile, "")
+	addRule(defs, "ConsistentIndentWidth", ruleCheckConsistentIndentWidth, nil, flagTextFile, "")
+	addRule(defs, "BadNameSpace", ruleCheckBadNameSpace, nil, flagTextFile, ".cs")
+	addRule(defs, "BadClassName", ruleCheckBadClassName, nil, flagTextFile, ".cs")
+	addRule(defs, "NoMultiplePublicClasses", ruleCheckNoMultiplePublicClasses, nil, flagTextFile, ".cs")
+	addRule(defs, "WindowsNewlines", ruleCheckWindowsNewlines, fixWindowsNewlines, flagTextFile, "")
+	addRule(defs, "LinuxNewlines", ruleCheckLinuxNewlines, fixLinuxNewlines, flagTextFile, "")
+	addRule(defs, "OldMacNewlines", ruleCheckOldMacNewlines, fixOldMacNewlines, flagTextFile, "")
+	addRule(defs, "NeedSpaceAfterKeyword", ruleCheckNeedSpaceAfterKeyword, fixNeedSpaceAfterKeyword, flagTextFile, ".cs")
+	addRule(defs, "LicenseHeader", ruleCheckLicenseHeader, fixLicenseHeader, flagTextFile, "")
 
 	return defs
 }
 
 // fileTypeFlags is a bit map int like flagTextFile | flagBinaryFile.
 // fileExtensions is a pipe separated string like ".cs|.java". Need the dot also.
-func addRule(rulesMap map[string]rule, ruleName string, checkFunc checkFuncType, fileTypeFlags int, fileExtensions string) {
+// fixFunc may be nil for rules that cannot be auto-corrected.
+func addRule(rulesMap map[string]rule, ruleName string, checkFunc checkFuncType, fixFunc fixFuncType, fileTypeFlags int, fileExtensions string) {
 	fileExtensionsArray := []string{}
 	if fileExtensions != "" {
 		fileExtensionsArray = strings.Split(fileExtensions, "|")
@@ -279,6 +309,7 @@ func addRule(rulesMap map[string]rule, ruleName string, checkFunc checkFuncType,
 	rulesMap[ruleName] = rule{
 		name:           ruleName,
 		checkFunc:      checkFunc,
+		fixFunc:        fixFunc,
 		fileTypeFlags:  fileTypeFlags,
 		fileExtensions: fileExtensionsArray,
 	}
@@ -303,7 +334,11 @@ func parseRule(line string) rule {
 	name := line[0:spaceIndex]
 	ruleDef := getRuleMustExist(name)
 	newRule := cloneRule(ruleDef)
-	newRule.argument = line[spaceIndex+1:]
+
+	argument, include, exclude := extractGlobTokens(line[spaceIndex+1:])
+	newRule.argument = argument
+	newRule.includeGlobs = include
+	newRule.excludeGlobs = exclude
 	return newRule
 }
 
@@ -312,41 +347,56 @@ func cloneRule(r rule) rule {
 		name:           r.name,
 		argument:       r.argument,
 		checkFunc:      r.checkFunc,
+		fixFunc:        r.fixFunc,
+		fileTypeFlags:  r.fileTypeFlags,
 		fileExtensions: r.fileExtensions,
+		includeGlobs:   r.includeGlobs,
+		excludeGlobs:   r.excludeGlobs,
 	}
 }
 
-func fileError(filePath, err string) string {
-	return filePath + ": " + err
+func fileError(args ruleCheckArgs, err string) []Diagnostic {
+	return []Diagnostic{{
+		Rule:     args.ruleName,
+		Path:     args.filePath,
+		Message:  err,
+		Severity: SeverityError,
+	}}
 }
 
-func fileAndLineError(filePath string, lineNum int, err string) string {
-	return filePath + ":" + strconv.Itoa(lineNum) + ": " + err
+func fileAndLineError(args ruleCheckArgs, lineNum int, err string) []Diagnostic {
+	return []Diagnostic{{
+		Rule:     args.ruleName,
+		Path:     args.filePath,
+		Line:     lineNum,
+		Message:  err,
+		Severity: SeverityError,
+	}}
 }
 
-func checkEachLine(filePath string, lines []string, errMsg string, isBad func(string) bool) string {
-	for lineNum, line := range lines {
+func checkEachLine(args ruleCheckArgs, errMsg string, isBad func(string) bool) []Diagnostic {
+	for lineNum, line := range args.fileAsLines {
 		if isBad(line) {
-			return fileAndLineError(filePath, lineNum+1, errMsg)
+			return fileAndLineError(args, lineNum+1, errMsg)
 		}
 	}
-	return ""
+	return nil
 }
 
-func ruleCheckDoNothing(args ruleCheckArgs) string {
-	return ""
+func ruleCheckDoNothing(args ruleCheckArgs) []Diagnostic {
+	return nil
 }
 
-func ruleCheckNoTabs(args ruleCheckArgs) string {
-	return checkEachLine(args.filePath, args.fileAsLines, "Tabs not allowed", lineContainsTab)
+func ruleCheckNoTabs(args ruleCheckArgs) []Diagnostic {
+	return checkEachLine(args, "Tabs not allowed", lineContainsTab)
 }
 
 func lineContainsTab(line string) bool {
 	return strings.ContainsRune(line, '\t')
 }
 
-func ruleCheckNoLeadingSpaces(args ruleCheckArgs) string {
-	return checkEachLine(args.filePath, args.fileAsLines, "Leading spaces not allowed", lineHasLeadingSpaces)
+func ruleCheckNoLeadingSpaces(args ruleCheckArgs) []Diagnostic {
+	return checkEachLine(args, "Leading spaces not allowed", lineHasLeadingSpaces)
 }
 
 func lineHasLeadingSpaces(line string) bool {
@@ -364,7 +414,7 @@ func lineHasLeadingSpaces(line string) bool {
 	return hasSpace
 }
 
-func ruleCheckTabsVsSpacesOnly(args ruleCheckArgs) string {
+func ruleCheckTabsVsSpacesOnly(args ruleCheckArgs) []Diagnostic {
 	hasTabIndent := false
 	hasSpaceIndent := false
 
@@ -372,12 +422,12 @@ func ruleCheckTabsVsSpacesOnly(args ruleCheckArgs) string {
 		for _, r := range line {
 			if r == ' ' {
 				if hasTabIndent {
-					return fileAndLineError(args.filePath, lineNum+1, "Found first space indent with prior tab indents")
+					return fileAndLineError(args, lineNum+1, "Found first space indent with prior tab indents")
 				}
 				hasSpaceIndent = true
 			} else if r == '\t' {
 				if hasSpaceIndent {
-					return fileAndLineError(args.filePath, lineNum+1, "Found first tab indent with prior space indents")
+					return fileAndLineError(args, lineNum+1, "Found first tab indent with prior space indents")
 				}
 				hasTabIndent = true
 			} else {
@@ -386,10 +436,10 @@ func ruleCheckTabsVsSpacesOnly(args ruleCheckArgs) string {
 		}
 	}
 
-	return ""
+	return nil
 }
 
-func ruleCheckConsistentNewlines(args ruleCheckArgs) string {
+func ruleCheckConsistentNewlines(args ruleCheckArgs) []Diagnostic {
 	hasWindows := strings.Contains(args.fileAsString, "\r\n")
 	s := strings.Replace(args.fileAsString, "\r\n", "", -1)
 
@@ -408,12 +458,12 @@ func ruleCheckConsistentNewlines(args ruleCheckArgs) string {
 	}
 
 	if count > 1 {
-		return fileError(args.filePath, "File uses inconsistent newlines")
+		return fileError(args, "File uses inconsistent newlines")
 	}
-	return ""
+	return nil
 }
 
-func ruleCheckConsistentIndentWidth(args ruleCheckArgs) string {
+func ruleCheckConsistentIndentWidth(args ruleCheckArgs) []Diagnostic {
 	all3Spaces := true
 	all4Spaces := true
 	firstNon3SpaceLineNum := 0
@@ -440,14 +490,14 @@ func ruleCheckConsistentIndentWidth(args ruleCheckArgs) string {
 
 	if !all3Spaces && !all4Spaces {
 		if !all4Spaces {
-			return fileAndLineError(args.filePath, firstNon4SpaceLineNum, "File has first non 4-space indent")
+			return fileAndLineError(args, firstNon4SpaceLineNum, "File has first non 4-space indent")
 		}
-		return fileAndLineError(args.filePath, firstNon3SpaceLineNum, "File has first non 3-space indent")
+		return fileAndLineError(args, firstNon3SpaceLineNum, "File has first non 3-space indent")
 	}
-	return ""
+	return nil
 }
 
-func ruleCheckBadNameSpace(args ruleCheckArgs) string {
+func ruleCheckBadNameSpace(args ruleCheckArgs) []Diagnostic {
 	pathAsNameSpace := ""
 
 	for lineNum, line := range args.fileAsLines {
@@ -463,11 +513,11 @@ func ruleCheckBadNameSpace(args ruleCheckArgs) string {
 		}
 
 		if !strings.HasSuffix(pathAsNameSpace, "."+namespace) {
-			return fileAndLineError(args.filePath, lineNum+1, "Namespace "+namespace+" is not a suffix of "+pathAsNameSpace)
+			return fileAndLineError(args, lineNum+1, "Namespace "+namespace+" is not a suffix of "+pathAsNameSpace)
 		}
 	}
 
-	return ""
+	return nil
 }
 
 func getFilePathAsNameSpace(filePath string) string {
@@ -490,7 +540,7 @@ func getFilePathAsNameSpace(filePath string) string {
 	return pathAsNameSpace
 }
 
-func ruleCheckBadClassName(args ruleCheckArgs) string {
+func ruleCheckBadClassName(args ruleCheckArgs) []Diagnostic {
 	base := filepath.Base(args.filePath)
 	base = base[0 : len(base)-len(".cs")]
 
@@ -509,14 +559,14 @@ func ruleCheckBadClassName(args ruleCheckArgs) string {
 		}
 
 		if className != base {
-			return fileAndLineError(args.filePath, lineNum+1, "Class name "+className+" should be "+base+" instead")
+			return fileAndLineError(args, lineNum+1, "Class name "+className+" should be "+base+" instead")
 		}
 	}
 
-	return ""
+	return nil
 }
 
-func ruleCheckNoMultiplePublicClasses(args ruleCheckArgs) string {
+func ruleCheckNoMultiplePublicClasses(args ruleCheckArgs) []Diagnostic {
 	count := 0
 	for lineNum, line := range args.fileAsLines {
 		line = strings.Trim(line, " \t")
@@ -524,81 +574,80 @@ func ruleCheckNoMultiplePublicClasses(args ruleCheckArgs) string {
 		if strings.HasPrefix(line, "public class ") {
 			count++
 			if count > 1 {
-				return fileAndLineError(args.filePath, lineNum+1, "Cannot have multiple public classes per file")
+				return fileAndLineError(args, lineNum+1, "Cannot have multiple public classes per file")
 			}
 		}
 	}
 
-	return ""
+	return nil
 }
 
-func ruleCheckWindowsNewlines(args ruleCheckArgs) string {
+func ruleCheckWindowsNewlines(args ruleCheckArgs) []Diagnostic {
 	s := strings.Replace(args.fileAsString, "\r\n", "", -1)
 	if strings.ContainsRune(s, '\n') {
-		return fileError(args.filePath, "File contains non-Windows (Linux) newlines")
+		return fileError(args, "File contains non-Windows (Linux) newlines")
 	}
 	if strings.ContainsRune(s, '\r') {
-		return fileError(args.filePath, "File contains non-Windows (Old Mac) newlines")
+		return fileError(args, "File contains non-Windows (Old Mac) newlines")
 	}
-	return ""
+	return nil
 }
 
-func ruleCheckLinuxNewlines(args ruleCheckArgs) string {
+func ruleCheckLinuxNewlines(args ruleCheckArgs) []Diagnostic {
 	if strings.Contains(args.fileAsString, "\r\n") {
-		return fileError(args.filePath, "File contains non-Linux (Windows) newlines")
+		return fileError(args, "File contains non-Linux (Windows) newlines")
 	}
 	s := strings.Replace(args.fileAsString, "\r\n", "", -1)
 	if strings.ContainsRune(s, '\r') {
-		return fileError(args.filePath, "File contains non-Linux (Old Mac) newlines")
+		return fileError(args, "File contains non-Linux (Old Mac) newlines")
 	}
-	return ""
+	return nil
 }
 
-func ruleCheckOldMacNewlines(args ruleCheckArgs) string {
+func ruleCheckOldMacNewlines(args ruleCheckArgs) []Diagnostic {
 	if strings.Contains(args.fileAsString, "\r\n") {
-		return fileError(args.filePath, "File contains non-Old Mac (Windows) newlines")
+		return fileError(args, "File contains non-Old Mac (Windows) newlines")
 	}
 	s := strings.Replace(args.fileAsString, "\r\n", "", -1)
 	if strings.ContainsRune(s, '\n') {
-		return fileError(args.filePath, "File contains non-Old Mac (Linux) newlines")
+		return fileError(args, "File contains non-Old Mac (Linux) newlines")
 	}
-	return ""
+	return nil
 }
 
-func ruleCheckNeedSpaceAfterKeyword(args ruleCheckArgs) string {
-	var buffer bytes.Buffer
+func ruleCheckNeedSpaceAfterKeyword(args ruleCheckArgs) []Diagnostic {
+	var diagnostics []Diagnostic
 
 	for lineNum, line := range args.fileAsLines {
 		line = strings.Trim(line, " \t")
 
 		for _, keyword := range csharpKeywordsWithSpacedParens {
 			if strings.HasPrefix(line, keyword+"(") {
-				buffer.WriteString(fileAndLineError(args.filePath, lineNum+1, "Need space between keyword "+keyword+" and open paren\n"))
+				diagnostics = append(diagnostics, fileAndLineError(args, lineNum+1, "Need space between keyword "+keyword+" and open paren")...)
 				continue
 			}
 		}
 	}
 
-	return buffer.String()
+	return diagnostics
 }
 
 /**************************************************************************/
 
 // Get list of files.
 
-func getListOfFiles() []string {
-	if len(os.Args) > 1 {
-		return getListOfFilesFromArguments()
+func getListOfFiles(fs Fs, args []string) []string {
+	if len(args) > 0 {
+		return getListOfFilesFromArguments(fs, args)
 	}
-	return getListOfFilesFromGit()
+	return getListOfFilesFromGit(fs)
 }
 
-func getListOfFilesFromArguments() []string {
+func getListOfFilesFromArguments(fs Fs, args []string) []string {
 	// Add all arguments including handling for globs.
 	var files []string
 
-	for i := 1; i < len(os.Args); i++ {
-		pattern := os.Args[i]
+	for _, pattern := range args {
 		if strings.ContainsAny(pattern, "?*") {
 			matches, err := filepath.Glob(pattern)
 			if err == nil {
@@ -616,7 +665,7 @@ func getListOfFilesFromArguments() []string {
 		f := files[len(files)-1]
 		files = files[0 : len(files)-1]
 
-		fileInfo, err := os.Stat(f)
+		fileInfo, err := fs.Stat(f)
 		if err != nil {
 			continue
 		}
@@ -628,12 +677,15 @@ func getListOfFilesFromArguments() []string {
 				continue
 			}
 
-			filePtr, err := os.Open(f)
+			childInfos, err := fs.ReadDir(f)
 			if err != nil {
 				continue
 			}
 
-			fileNames, err := filePtr.Readdirnames(-1)
+			fileNames := make([]string, len(childInfos))
+			for i, childInfo := range childInfos {
+				fileNames[i] = childInfo.Name()
+			}
 			sort.Strings(fileNames)
 			for _, fn := range fileNames {
 				fn = path.Join(f, fn)
@@ -647,8 +699,8 @@ func getListOfFilesFromArguments() []string {
 	return files2
 }
 
-func getListOfFilesFromGit() []string {
-	gotoGitRepoRootDir()
+func getListOfFilesFromGit(fs Fs) []string {
+	gotoGitRepoRootDir(fs)
 
 	// Get list of modified and staged files from git.
 	diff1 := execAndGetOutput("git", []string{"diff", "--name-only", "--cached"})
@@ -666,8 +718,14 @@ func getListOfFilesFromGit() []string {
 	return append(append(array1, array2...), array3...)
 }
 
-func gotoGitRepoRootDir() {
-	filePath, _ := filepath.Abs(".")
+// findRepoRootDir walks upward from the current directory looking for a
+// ".git" directory, without changing the current directory. It goes
+// through fs so it can be driven against a MemMapFs in tests.
+func findRepoRootDir(fs Fs) (string, bool) {
+	filePath, err := fs.Getwd()
+	if err != nil {
+		return "", false
+	}
 	filePath = strings.Replace(filePath, "\\", "/", -1)
 	paths := strings.Split(filePath, "/")
 
@@ -675,69 +733,194 @@ func gotoGitRepoRootDir() {
 		d := strings.Join(paths, "/")
 		p := d + "/.git"
 
-		fileInfo, err := os.Stat(p)
+		fileInfo, err := fs.Stat(p)
 		if err == nil && fileInfo.IsDir() {
-			os.Chdir(d)
-			return
+			return d, true
 		}
 
 		paths = paths[0 : len(paths)-1]
 	}
 
-	fatal("Not a git repository")
+	return "", false
+}
+
+func gotoGitRepoRootDir(fs Fs) {
+	dir, ok := findRepoRootDir(fs)
+	if !ok {
+		fatal("Not a git repository")
+	}
+	fs.Chdir(dir)
 }
 
 /**************************************************************************/
 
 // Run rules.
 
-func runRulesOnFiles(rules []rule, files []string) {
-	for _, filePath := range files {
-		fileExtension := filepath.Ext(filePath)
-		filePath := getCanonicalPath(filePath)
-		fileLoaded := false
-		fileAsString := ""
-		var fileAsLines []string
+// defaultJobCount is the --jobs default: one worker per CPU.
+func defaultJobCount() int {
+	return runtime.NumCPU()
+}
 
-		firstNChars := readFirstNChars(filePath, 50)
-		isBinary := hasControlCharacters(firstNChars)
+// ruleAppliesToFile reports whether rule is in scope for a file with the
+// given extension, repo-relative path, and binary/text classification, i.e.
+// whether processFile would run its checkFunc against it.
+func ruleAppliesToFile(rule rule, fileExtension string, relPath string, isBinary bool) bool {
+	if len(rule.fileExtensions) != 0 && !stringArrayContains(rule.fileExtensions, fileExtension) {
+		return false
+	}
+	if len(rule.includeGlobs) != 0 && !matchAnyGlob(rule.includeGlobs, relPath) {
+		return false
+	}
+	if len(rule.excludeGlobs) != 0 && matchAnyGlob(rule.excludeGlobs, relPath) {
+		return false
+	}
+	if isBinary && (rule.fileTypeFlags&flagBinaryFile == 0) {
+		return false
+	}
+	if !isBinary && (rule.fileTypeFlags&flagTextFile == 0) {
+		return false
+	}
+	return true
+}
 
-		for _, rule := range rules {
-			// Skip by file extension.
-			if len(rule.fileExtensions) != 0 && !stringArrayContains(rule.fileExtensions, fileExtension) {
-				continue
-			}
+// resolvedRuleSetFingerprint names the subset of rules that apply to a file
+// (after extension/include/exclude/binary-text filtering), joined in their
+// config-file order. Two files can only safely share a cache entry if this
+// fingerprint, not just their raw contents, is identical.
+func resolvedRuleSetFingerprint(rules []rule, fileExtension string, relPath string, isBinary bool) string {
+	var applicable []string
+	for _, rule := range rules {
+		if ruleAppliesToFile(rule, fileExtension, relPath, isBinary) {
+			applicable = append(applicable, rule.name)
+		}
+	}
+	return hashString(strings.Join(applicable, ","))
+}
 
-			// Skip binary files.
-			if isBinary && (rule.fileTypeFlags&flagBinaryFile == 0) {
-				continue
-			}
+// processFile runs every applicable rule against one file and returns its
+// diagnostics. Errors (an unreadable file, say) are returned rather than
+// passed to fatal, so one bad file doesn't kill its sibling workers.
+func processFile(fs Fs, rules []rule, filePath string, configHash string, ignorePatterns []ignorePattern) ([]Diagnostic, error) {
+	fileExtension := filepath.Ext(filePath)
+	filePath = getCanonicalPath(filePath)
+	relPath := relativePathForGlob(fs, filePath)
 
-			// Skip text files.
-			if !isBinary && (rule.fileTypeFlags&flagTextFile == 0) {
-				continue
-			}
+	if isIgnoredByGitSanityIgnore(ignorePatterns, relPath) {
+		return nil, nil
+	}
 
-			// Lazy load files.
-			if !fileLoaded {
-				fileAsString = readFileString(filePath)
-				fileAsLines = convertStringToLines(fileAsString, false)
-				fileLoaded = true
+	firstNChars, err := readFirstNCharsFs(fs, filePath, 50)
+	if err != nil {
+		return nil, err
+	}
+	isBinary := hasControlCharacters(firstNChars)
+	ruleSetHash := resolvedRuleSetFingerprint(rules, fileExtension, relPath, isBinary)
+
+	cacheKey, cached, hit := lookupCachedDiagnostics(fs, filePath, configHash, ruleSetHash)
+	if hit {
+		cachedDiagnostics := decodeDiagnostics(cached)
+		for i := range cachedDiagnostics {
+			cachedDiagnostics[i].Path = filePath
+		}
+		return cachedDiagnostics, nil
+	}
+
+	fileLoaded := false
+	fileAsString := ""
+	var fileAsLines []string
+	var fileDiagnostics []Diagnostic
+
+	for _, rule := range rules {
+		if !ruleAppliesToFile(rule, fileExtension, relPath, isBinary) {
+			continue
+		}
+
+		// Lazy load files.
+		if !fileLoaded {
+			fileAsString, err = readFileStringFs(fs, filePath)
+			if err != nil {
+				return nil, err
 			}
+			fileAsLines = convertStringToLines(fileAsString, false)
+			fileLoaded = true
+		}
 
-			// Perform rule check.
-			msg := rule.checkFunc(ruleCheckArgs{
-				filePath:     filePath,
-				fileAsString: fileAsString,
-				fileAsLines:  fileAsLines,
-			})
+		// Perform rule check.
+		fileDiagnostics = append(fileDiagnostics, rule.checkFunc(ruleCheckArgs{
+			fs:           fs,
+			filePath:     filePath,
+			fileAsString: fileAsString,
+			fileAsLines:  fileAsLines,
+			argument:     rule.argument,
+			ruleName:     rule.name,
+		})...)
+	}
 
-			// Print error message if any.
-			if msg != "" {
-				fmt.Println(msg)
+	storeCachedDiagnostics(cacheKey, encodeDiagnostics(stripDiagnosticPaths(fileDiagnostics)))
+	return fileDiagnostics, nil
+}
+
+// fileJobResult is what each worker sends back to the collector.
+type fileJobResult struct {
+	diagnostics []Diagnostic
+	err         error
+}
+
+// runRulesOnFiles checks every file in files against rules, using a bounded
+// pool of jobs workers: a producer goroutine feeds file paths into jobsCh,
+// each worker runs processFile and sends its result to resultsCh, and this
+// goroutine collects every result before sorting and printing, so output
+// ordering does not depend on which worker finishes first.
+func runRulesOnFiles(fs Fs, rules []rule, files []string, jobs int) {
+	configHash := ""
+	if !noCacheMode {
+		configHash = configFileFingerprint()
+	}
+
+	ignorePatterns := loadGitSanityIgnore(fs)
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	jobsCh := make(chan string)
+	resultsCh := make(chan fileJobResult, len(files))
+
+	var workers sync.WaitGroup
+	for i := 0; i < jobs; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for filePath := range jobsCh {
+				diagnostics, err := processFile(fs, rules, filePath, configHash, ignorePatterns)
+				resultsCh <- fileJobResult{diagnostics: diagnostics, err: err}
 			}
+		}()
+	}
+
+	go func() {
+		for _, filePath := range files {
+			jobsCh <- filePath
+		}
+		close(jobsCh)
+	}()
+
+	go func() {
+		workers.Wait()
+		close(resultsCh)
+	}()
+
+	var allDiagnostics []Diagnostic
+	for result := range resultsCh {
+		if result.err != nil {
+			fmt.Fprintln(os.Stderr, result.err.Error())
+			continue
 		}
+		allDiagnostics = append(allDiagnostics, result.diagnostics...)
 	}
+
+	sortDiagnostics(allDiagnostics)
+	printDiagnostics(allDiagnostics)
 }
 
 /**************************************************************************/
@@ -745,14 +928,44 @@ func runRulesOnFiles(rules []rule, files []string) {
 // Main.
 
 func main() {
-	rules := loadConfigFile()
-	files := getListOfFiles()
+	fixMode := flag.Bool("fix", false, "Rewrite files in place to auto-correct fixable violations")
+	diffMode := flag.Bool("diff", false, "Print unified diffs of the fixes instead of writing them")
+	noCache := flag.Bool("no-cache", false, "Disable the result cache and always re-check every file")
+	clearCacheMode := flag.Bool("clear-cache", false, "Delete all cached results and exit")
+	format := flag.String("format", "text", "Diagnostic output format: text, json, sarif, or checkstyle")
+	jobs := flag.Int("jobs", defaultJobCount(), "Number of files to check concurrently")
+	flag.Parse()
+
+	noCacheMode = *noCache
+	reportFormat = *format
+
+	if *clearCacheMode {
+		clearCache()
+		return
+	}
+	if !noCacheMode {
+		gcCacheOlderThan(cacheMaxAgeDays)
+	}
+
+	fs := OsFs{}
+	rules := loadConfigFile(fs)
+	files := getListOfFiles(fs, flag.Args())
 
 	if len(files) == 0 {
 		return
 	}
 
-	runRulesOnFiles(rules, files)
+	if *diffMode {
+		printFixDiffs(rules, files)
+		return
+	}
+
+	if *fixMode {
+		applyFixes(rules, files)
+		return
+	}
+
+	runRulesOnFiles(fs, rules, files, *jobs)
 }
 
 /**************************************************************************/
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+const benchmarkCorpusFileCount = 10000
+
+// generateBenchmarkCorpus writes benchmarkCorpusFileCount small .cs files
+// under a fresh temp directory and returns their paths.
+func generateBenchmarkCorpus(b *testing.B) (string, []string) {
+	dir, err := ioutil.TempDir("", "git-sanity-checker-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	content := "namespace Foo.Bar {\n    public class Widget {\n    }\n}\n"
+	files := make([]string, benchmarkCorpusFileCount)
+	for i := 0; i < benchmarkCorpusFileCount; i++ {
+		filePath := filepath.Join(dir, fmt.Sprintf("widget%05d.cs", i))
+		if err := ioutil.WriteFile(filePath, []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+		files[i] = filePath
+	}
+	return dir, files
+}
+
+// BenchmarkRunRulesOnFilesJobs checks a synthetic 10k-file corpus at
+// increasing --jobs values, to show that the runRulesOnFiles worker pool
+// actually scales with the number of workers.
+func BenchmarkRunRulesOnFilesJobs(b *testing.B) {
+	dir, files := generateBenchmarkCorpus(b)
+	defer os.RemoveAll(dir)
+
+	noCacheMode = true
+	defer func() { noCacheMode = false }()
+
+	// Discard the text output so it doesn't dominate the benchmark.
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer devNull.Close()
+	realStdout := os.Stdout
+	os.Stdout = devNull
+	defer func() { os.Stdout = realStdout }()
+
+	rules := []rule{rulesDefinitions["NoTabs"], rulesDefinitions["ConsistentNewlines"]}
+
+	for _, jobs := range []int{1, 2, 4, runtime.NumCPU()} {
+		jobs := jobs
+		b.Run(fmt.Sprintf("jobs=%d", jobs), func(b *testing.B) {
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				runRulesOnFiles(OsFs{}, rules, files, jobs)
+			}
+		})
+	}
+}
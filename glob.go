@@ -0,0 +1,174 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/**************************************************************************/
+
+// Include/exclude globs and .gitsanityignore.
+//
+// Patterns use doublestar semantics: "**" matches any number of path
+// segments, "*" matches within a single segment, "?" matches a single
+// character within a segment.
+
+const gitSanityIgnoreFileName = ".gitsanityignore"
+
+// extractGlobTokens pulls any "include=a,b" / "exclude=c,d" tokens out of a
+// rule's raw argument text and returns what remains alongside the parsed
+// glob lists.
+func extractGlobTokens(rest string) (remaining string, include []string, exclude []string) {
+	var kept []string
+
+	for _, field := range strings.Fields(rest) {
+		switch {
+		case strings.HasPrefix(field, "include="):
+			include = append(include, strings.Split(field[len("include="):], ",")...)
+		case strings.HasPrefix(field, "exclude="):
+			exclude = append(exclude, strings.Split(field[len("exclude="):], ",")...)
+		default:
+			kept = append(kept, field)
+		}
+	}
+
+	return strings.Join(kept, " "), include, exclude
+}
+
+func matchAnyGlob(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if globMatch(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// globMatch reports whether relPath matches pattern, with "**" in pattern
+// matching any number of path segments (including zero).
+func globMatch(pattern string, relPath string) bool {
+	return globMatchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+func globMatchSegments(patternSegs []string, pathSegs []string) bool {
+	if len(patternSegs) == 0 {
+		return len(pathSegs) == 0
+	}
+
+	seg := patternSegs[0]
+
+	if seg == "**" {
+		if globMatchSegments(patternSegs[1:], pathSegs) {
+			return true
+		}
+		if len(pathSegs) == 0 {
+			return false
+		}
+		return globMatchSegments(patternSegs, pathSegs[1:])
+	}
+
+	if len(pathSegs) == 0 {
+		return false
+	}
+
+	matched, err := path.Match(seg, pathSegs[0])
+	if err != nil || !matched {
+		return false
+	}
+
+	return globMatchSegments(patternSegs[1:], pathSegs[1:])
+}
+
+// relativePathForGlob returns filePath relative to the repo root (falling
+// back to the absolute path outside a repo), with forward slashes so
+// globs behave the same on every platform.
+func relativePathForGlob(fs Fs, filePath string) string {
+	absPath := getCanonicalPath(filePath)
+
+	repoRoot, ok := findRepoRootDir(fs)
+	if !ok {
+		return filepath.ToSlash(absPath)
+	}
+
+	rel, err := filepath.Rel(repoRoot, absPath)
+	if err != nil {
+		return filepath.ToSlash(absPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+/**************************************************************************/
+
+// .gitsanityignore.
+
+type ignorePattern struct {
+	glob   string
+	negate bool
+}
+
+// loadGitSanityIgnore reads the repo-root .gitsanityignore file, if any.
+func loadGitSanityIgnore(fs Fs) []ignorePattern {
+	repoRoot, ok := findRepoRootDir(fs)
+	if !ok {
+		return nil
+	}
+
+	data, err := fs.ReadFile(filepath.Join(repoRoot, gitSanityIgnoreFileName))
+	if err != nil {
+		return nil
+	}
+
+	return parseGitSanityIgnore(string(data))
+}
+
+// parseGitSanityIgnore parses the contents of a .gitsanityignore file into
+// ignorePatterns, applying .gitignore syntax rules.
+func parseGitSanityIgnore(data string) []ignorePattern {
+	var patterns []ignorePattern
+	for _, line := range convertStringToLines(data, false) {
+		line = strings.Trim(line, " \t")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		negate := strings.HasPrefix(line, "!")
+		if negate {
+			line = line[1:]
+		}
+
+		// A pattern with no slash other than a trailing one isn't anchored
+		// to the repo root in .gitignore semantics: it matches at any
+		// directory depth, not just at the top level.
+		anchored := strings.Contains(strings.TrimSuffix(line, "/"), "/")
+
+		// A trailing "/" means "this directory and everything below it",
+		// same as .gitignore.
+		if strings.HasSuffix(line, "/") {
+			line = strings.TrimSuffix(line, "/") + "/**"
+		}
+
+		if !anchored {
+			line = "**/" + line
+		}
+
+		patterns = append(patterns, ignorePattern{glob: line, negate: negate})
+	}
+	return patterns
+}
+
+// isIgnoredByGitSanityIgnore applies gitignore semantics: the last matching
+// pattern wins, and a "!" pattern re-includes a path excluded earlier.
+func isIgnoredByGitSanityIgnore(patterns []ignorePattern, relPath string) bool {
+	ignored := false
+	for _, p := range patterns {
+		if globMatch(p.glob, relPath) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+/**************************************************************************/
+
+// End.
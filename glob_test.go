@@ -0,0 +1,113 @@
+package main
+
+import "testing"
+
+func TestMatchAnyGlob(t *testing.T) {
+	cases := []struct {
+		name     string
+		patterns []string
+		relPath  string
+		want     bool
+	}{
+		{
+			name:     "exact segment match",
+			patterns: []string{"src/a.cs"},
+			relPath:  "src/a.cs",
+			want:     true,
+		},
+		{
+			name:     "single star does not cross a segment boundary",
+			patterns: []string{"src/*.cs"},
+			relPath:  "src/sub/a.cs",
+			want:     false,
+		},
+		{
+			name:     "single star matches within a segment",
+			patterns: []string{"src/*.cs"},
+			relPath:  "src/a.cs",
+			want:     true,
+		},
+		{
+			name:     "doublestar matches zero segments",
+			patterns: []string{"src/**/a.cs"},
+			relPath:  "src/a.cs",
+			want:     true,
+		},
+		{
+			name:     "doublestar matches multiple segments",
+			patterns: []string{"src/**/a.cs"},
+			relPath:  "src/sub/sub2/a.cs",
+			want:     true,
+		},
+		{
+			name:     "leading doublestar matches any depth",
+			patterns: []string{"**/vendor/**"},
+			relPath:  "src/vendor/b.cs",
+			want:     true,
+		},
+		{
+			name:     "none of multiple patterns match",
+			patterns: []string{"other/**", "another/**"},
+			relPath:  "src/a.cs",
+			want:     false,
+		},
+		{
+			name:     "second of multiple patterns matches",
+			patterns: []string{"other/**", "src/**"},
+			relPath:  "src/a.cs",
+			want:     true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			got := matchAnyGlob(c.patterns, c.relPath)
+			if got != c.want {
+				t.Errorf("matchAnyGlob(%v, %q) = %v, want %v", c.patterns, c.relPath, got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseGitSanityIgnore(t *testing.T) {
+	patterns := parseGitSanityIgnore("# comment\n\nvendor/\nsrc/generated/**\n!src/generated/keep.cs\n")
+
+	want := []ignorePattern{
+		{glob: "**/vendor/**", negate: false},
+		{glob: "src/generated/**", negate: false},
+		{glob: "src/generated/keep.cs", negate: true},
+	}
+
+	if len(patterns) != len(want) {
+		t.Fatalf("parseGitSanityIgnore: got %d patterns %v, want %d", len(patterns), patterns, len(want))
+	}
+	for i := range want {
+		if patterns[i] != want[i] {
+			t.Errorf("pattern %d: got %+v, want %+v", i, patterns[i], want[i])
+		}
+	}
+}
+
+func TestIsIgnoredByGitSanityIgnore(t *testing.T) {
+	// A bare "vendor/" pattern has to match at any depth, not just at the
+	// repo root, the same way .gitignore treats it.
+	patterns := parseGitSanityIgnore("vendor/\n!vendor/keep.cs\n")
+
+	cases := []struct {
+		relPath string
+		want    bool
+	}{
+		{relPath: "vendor/d.cs", want: true},
+		{relPath: "src/vendor/b.cs", want: true},
+		{relPath: "vendor/keep.cs", want: false},
+		{relPath: "src/a.cs", want: false},
+	}
+
+	for _, c := range cases {
+		got := isIgnoredByGitSanityIgnore(patterns, c.relPath)
+		if got != c.want {
+			t.Errorf("isIgnoredByGitSanityIgnore(%q) = %v, want %v", c.relPath, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+/**************************************************************************/
+
+// LicenseHeader rule.
+//
+// rule.argument has the form "<spdx-id-or-template-path> <year> <holder>",
+// e.g. "Apache-2.0 2016 Lau, Chok Sheak". The identifier is looked up in
+// spdxLicenseTemplates; anything else is treated as a path to a template
+// file. Both support {{.Year}} and {{.Holder}} placeholders.
+
+// spdxLicenseTemplates holds the standard short-form notice for each
+// supported SPDX identifier, the same text tools like addlicense prepend.
+var spdxLicenseTemplates = map[string]string{
+	"MIT": `MIT License
+
+Copyright (c) {{.Year}} {{.Holder}}
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.`,
+
+	"Apache-2.0": `Copyright {{.Year}} {{.Holder}}
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.`,
+
+	"BSD-3-Clause": `Copyright (c) {{.Year}}, {{.Holder}}
+All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are met:
+
+1. Redistributions of source code must retain the above copyright notice,
+   this list of conditions and the following disclaimer.
+2. Redistributions in binary form must reproduce the above copyright notice,
+   this list of conditions and the following disclaimer in the documentation
+   and/or other materials provided with the distribution.
+3. Neither the name of the copyright holder nor the names of its
+   contributors may be used to endorse or promote products derived from
+   this software without specific prior written permission.`,
+
+	"GPL-3.0": `Copyright (C) {{.Year}} {{.Holder}}
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+GNU General Public License for more details.`,
+
+	"MPL-2.0": `This Source Code Form is subject to the terms of the Mozilla Public
+License, v. 2.0. If a copy of the MPL was not distributed with this
+file, You can obtain one at http://mozilla.org/MPL/2.0/.`,
+}
+
+// commentStyle describes how to turn a plain text line into a comment line
+// for a given source language.
+type commentStyle struct {
+	linePrefix string
+	blockOpen  string
+	blockClose string
+}
+
+var defaultCommentStyle = commentStyle{linePrefix: "// "}
+
+var commentStylesByExtension = map[string]commentStyle{
+	".go":   {linePrefix: "// "},
+	".cs":   {linePrefix: "// "},
+	".java": {linePrefix: "// "},
+	".js":   {linePrefix: "// "},
+	".ts":   {linePrefix: "// "},
+	".c":    {linePrefix: "// "},
+	".cpp":  {linePrefix: "// "},
+	".h":    {linePrefix: "// "},
+	".sh":   {linePrefix: "# "},
+	".py":   {linePrefix: "# "},
+	".rb":   {linePrefix: "# "},
+	".yml":  {linePrefix: "# "},
+	".yaml": {linePrefix: "# "},
+	".css":  {blockOpen: "/* ", blockClose: " */"},
+	".html": {blockOpen: "<!-- ", blockClose: " -->"},
+	".xml":  {blockOpen: "<!-- ", blockClose: " -->"},
+}
+
+func commentStyleForFile(filePath string) commentStyle {
+	style, ok := commentStylesByExtension[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		return defaultCommentStyle
+	}
+	return style
+}
+
+func wrapLicenseHeaderLine(style commentStyle, line string) string {
+	if style.blockOpen != "" {
+		return style.blockOpen + line + style.blockClose
+	}
+	if line == "" {
+		return strings.TrimRight(style.linePrefix, " ")
+	}
+	return style.linePrefix + line
+}
+
+func wrapLicenseHeaderLines(style commentStyle, lines []string) []string {
+	wrapped := make([]string, len(lines))
+	for i, line := range lines {
+		wrapped[i] = wrapLicenseHeaderLine(style, line)
+	}
+	return wrapped
+}
+
+func parseLicenseHeaderArgument(argument string) (id string, year string, holder string) {
+	parts := strings.SplitN(argument, " ", 3)
+	if len(parts) > 0 {
+		id = parts[0]
+	}
+	if len(parts) > 1 {
+		year = parts[1]
+	}
+	if len(parts) > 2 {
+		holder = parts[2]
+	}
+	return id, year, holder
+}
+
+// getLicenseTemplate looks up idOrPath as an SPDX identifier first, then
+// falls back to reading it as a template file path through fs.
+func getLicenseTemplate(fs Fs, idOrPath string) (string, error) {
+	if body, ok := spdxLicenseTemplates[idOrPath]; ok {
+		return body, nil
+	}
+
+	data, err := fs.ReadFile(idOrPath)
+	if err != nil {
+		return "", errors.New("Unknown SPDX license \"" + idOrPath + "\" and cannot read it as a template file: " + err.Error())
+	}
+	return string(data), nil
+}
+
+func renderLicenseTemplate(body string, year string, holder string) (string, error) {
+	tmpl, err := template.New("licenseHeader").Parse(body)
+	if err != nil {
+		return "", err
+	}
+
+	var buffer bytes.Buffer
+	err = tmpl.Execute(&buffer, struct {
+		Year   string
+		Holder string
+	}{Year: year, Holder: holder})
+	if err != nil {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// renderedLicenseHeaderLines resolves rule.argument into the comment-wrapped
+// header lines expected at the top of filePath.
+func renderedLicenseHeaderLines(fs Fs, filePath string, argument string) ([]string, error) {
+	id, year, holder := parseLicenseHeaderArgument(argument)
+
+	body, err := getLicenseTemplate(fs, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rendered, err := renderLicenseTemplate(body, year, holder)
+	if err != nil {
+		return nil, err
+	}
+
+	style := commentStyleForFile(filePath)
+	return wrapLicenseHeaderLines(style, strings.Split(rendered, "\n")), nil
+}
+
+// fileHasLicenseHeaderLines reports whether fileAsLines begins with
+// headerLines verbatim, line for line. The header has to anchor the start
+// of the file, not merely appear somewhere near the top of it.
+func fileHasLicenseHeaderLines(fileAsLines []string, headerLines []string) bool {
+	if len(fileAsLines) < len(headerLines) {
+		return false
+	}
+	for i, line := range headerLines {
+		if fileAsLines[i] != line {
+			return false
+		}
+	}
+	return true
+}
+
+func ruleCheckLicenseHeader(args ruleCheckArgs) []Diagnostic {
+	headerLines, err := renderedLicenseHeaderLines(args.fs, args.filePath, args.argument)
+	if err != nil {
+		return fileError(args, err.Error())
+	}
+
+	if !fileHasLicenseHeaderLines(args.fileAsLines, headerLines) {
+		return fileError(args, "Missing or incorrect license header")
+	}
+	return nil
+}
+
+func fixLicenseHeader(args ruleCheckArgs) (string, bool) {
+	headerLines, err := renderedLicenseHeaderLines(args.fs, args.filePath, args.argument)
+	if err != nil {
+		return args.fileAsString, false
+	}
+
+	if fileHasLicenseHeaderLines(args.fileAsLines, headerLines) {
+		return args.fileAsString, false
+	}
+
+	header := strings.Join(headerLines, "\n")
+	return header + "\n\n" + args.fileAsString, true
+}
+
+/**************************************************************************/
+
+// End.
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+/**************************************************************************/
+
+// Structured diagnostics and reporters.
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Diagnostic is one rule violation found in one file.
+type Diagnostic struct {
+	Rule     string `json:"rule"`
+	Path     string `json:"path"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// Reporter renders a batch of diagnostics for one output format.
+type Reporter interface {
+	Report(diagnostics []Diagnostic) string
+}
+
+// reportFormat is set from the --format flag in main().
+var reportFormat = "text"
+
+func getReporter(format string) Reporter {
+	switch format {
+	case "json":
+		return jsonReporter{}
+	case "sarif":
+		return sarifReporter{}
+	case "checkstyle":
+		return checkstyleReporter{}
+	default:
+		return textReporter{}
+	}
+}
+
+func printDiagnostics(diagnostics []Diagnostic) {
+	output := getReporter(reportFormat).Report(diagnostics)
+	if output != "" {
+		fmt.Print(output)
+	}
+}
+
+func encodeDiagnostics(diagnostics []Diagnostic) string {
+	data, err := json.Marshal(diagnostics)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func decodeDiagnostics(data string) []Diagnostic {
+	var diagnostics []Diagnostic
+	if data == "" {
+		return nil
+	}
+	json.Unmarshal([]byte(data), &diagnostics)
+	return diagnostics
+}
+
+// stripDiagnosticPaths returns a copy of diagnostics with Path cleared. The
+// cache key is derived from file contents, not file path, so two files with
+// identical contents share a cache entry; the Path field belongs to whichever
+// file is being checked at lookup time, not to the cached entry, so it must
+// not be persisted as part of it.
+func stripDiagnosticPaths(diagnostics []Diagnostic) []Diagnostic {
+	stripped := make([]Diagnostic, len(diagnostics))
+	for i, d := range diagnostics {
+		d.Path = ""
+		stripped[i] = d
+	}
+	return stripped
+}
+
+// sortDiagnostics orders diagnostics by path, then line, then rule, so that
+// output from the runRulesOnFiles worker pool is deterministic regardless of
+// which worker finished first, even when multiple rules flag the same line.
+func sortDiagnostics(diagnostics []Diagnostic) {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].Path != diagnostics[j].Path {
+			return diagnostics[i].Path < diagnostics[j].Path
+		}
+		if diagnostics[i].Line != diagnostics[j].Line {
+			return diagnostics[i].Line < diagnostics[j].Line
+		}
+		return diagnostics[i].Rule < diagnostics[j].Rule
+	})
+}
+
+/**************************************************************************/
+
+// text reporter: the original "path:line: message" format, unchanged.
+
+type textReporter struct{}
+
+func (textReporter) Report(diagnostics []Diagnostic) string {
+	var buffer bytes.Buffer
+	for _, d := range diagnostics {
+		if d.Line > 0 {
+			buffer.WriteString(d.Path + ":" + strconv.Itoa(d.Line) + ": " + d.Message + "\n")
+		} else {
+			buffer.WriteString(d.Path + ": " + d.Message + "\n")
+		}
+	}
+	return buffer.String()
+}
+
+/**************************************************************************/
+
+// json reporter: one object per finding.
+
+type jsonReporter struct{}
+
+func (jsonReporter) Report(diagnostics []Diagnostic) string {
+	if diagnostics == nil {
+		diagnostics = []Diagnostic{}
+	}
+	data, err := json.MarshalIndent(diagnostics, "", "  ")
+	if err != nil {
+		fatal(err.Error())
+	}
+	return string(data) + "\n"
+}
+
+/**************************************************************************/
+
+// sarif reporter: SARIF 2.1.0, for GitHub code scanning.
+
+type sarifReportingDescriptor struct {
+	ID string `json:"id"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine,omitempty"`
+	StartColumn int `json:"startColumn,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifDriver struct {
+	Name  string                     `json:"name"`
+	Rules []sarifReportingDescriptor `json:"rules"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+func sarifLevel(severity string) string {
+	if severity == SeverityWarning {
+		return "warning"
+	}
+	return "error"
+}
+
+type sarifReporter struct{}
+
+func (sarifReporter) Report(diagnostics []Diagnostic) string {
+	ruleIDs := []string{}
+	seenRuleIDs := map[string]bool{}
+	for name := range rulesDefinitions {
+		if !seenRuleIDs[name] {
+			seenRuleIDs[name] = true
+			ruleIDs = append(ruleIDs, name)
+		}
+	}
+	// rulesDefinitions is a map, so range order is randomized per run; sort
+	// so the rules catalog is byte-for-byte identical across unchanged runs.
+	sort.Strings(ruleIDs)
+
+	rules := make([]sarifReportingDescriptor, len(ruleIDs))
+	for i, id := range ruleIDs {
+		rules[i] = sarifReportingDescriptor{ID: id}
+	}
+
+	results := make([]sarifResult, len(diagnostics))
+	for i, d := range diagnostics {
+		results[i] = sarifResult{
+			RuleID:  d.Rule,
+			Level:   sarifLevel(d.Severity),
+			Message: sarifMessage{Text: d.Message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: d.Path},
+					Region:           sarifRegion{StartLine: d.Line, StartColumn: d.Col},
+				},
+			}},
+		}
+	}
+
+	log := sarifLog{
+		Schema:  "https://raw.githubusercontent.com/oasis-tcs/sarif-spec/master/Schemata/sarif-schema-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "git-sanity-checker", Rules: rules}},
+			Results: results,
+		}},
+	}
+
+	data, err := json.MarshalIndent(log, "", "  ")
+	if err != nil {
+		fatal(err.Error())
+	}
+	return string(data) + "\n"
+}
+
+/**************************************************************************/
+
+// checkstyle reporter: the XML format consumed by Jenkins and many editors.
+
+type checkstyleError struct {
+	XMLName  xml.Name `xml:"error"`
+	Line     int      `xml:"line,attr"`
+	Column   int      `xml:"column,attr,omitempty"`
+	Severity string   `xml:"severity,attr"`
+	Message  string   `xml:"message,attr"`
+	Source   string   `xml:"source,attr"`
+}
+
+type checkstyleFile struct {
+	XMLName xml.Name          `xml:"file"`
+	Name    string            `xml:"name,attr"`
+	Errors  []checkstyleError `xml:"error"`
+}
+
+type checkstyleRoot struct {
+	XMLName xml.Name         `xml:"checkstyle"`
+	Version string           `xml:"version,attr"`
+	Files   []checkstyleFile `xml:"file"`
+}
+
+type checkstyleReporter struct{}
+
+func (checkstyleReporter) Report(diagnostics []Diagnostic) string {
+	filesByPath := map[string]*checkstyleFile{}
+	var order []string
+
+	for _, d := range diagnostics {
+		f, ok := filesByPath[d.Path]
+		if !ok {
+			f = &checkstyleFile{Name: d.Path}
+			filesByPath[d.Path] = f
+			order = append(order, d.Path)
+		}
+		f.Errors = append(f.Errors, checkstyleError{
+			Line:     d.Line,
+			Column:   d.Col,
+			Severity: d.Severity,
+			Message:  d.Message,
+			Source:   d.Rule,
+		})
+	}
+
+	root := checkstyleRoot{Version: "8.0"}
+	for _, path := range order {
+		root.Files = append(root.Files, *filesByPath[path])
+	}
+
+	data, err := xml.MarshalIndent(root, "", "  ")
+	if err != nil {
+		fatal(err.Error())
+	}
+	return xml.Header + string(data) + "\n"
+}
+
+/**************************************************************************/
+
+// End.
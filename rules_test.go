@@ -0,0 +1,255 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runRuleCheck runs a single rule against one file held in a fresh MemMapFs
+// and returns its diagnostics rendered through the text reporter, the same
+// format a user would see on the command line.
+func runRuleCheck(t *testing.T, r rule, filePath string, contents string) string {
+	t.Helper()
+
+	fs := NewMemMapFs()
+	fs.WriteFile(filePath, contents)
+
+	noCacheMode = true
+	diagnostics, err := processFile(fs, []rule{r}, filePath, "", nil)
+	if err != nil {
+		t.Fatalf("processFile(%q): %v", filePath, err)
+	}
+	return textReporter{}.Report(diagnostics)
+}
+
+func TestRuleChecks(t *testing.T) {
+	licenseRule := cloneRule(rulesDefinitions["LicenseHeader"])
+	licenseRule.argument = "MIT 2016 Lau, Chok Sheak"
+
+	licenseFilePath := "/virtual/src/licensed.go"
+	licenseHeaderLines, err := renderedLicenseHeaderLines(NewMemMapFs(), licenseFilePath, licenseRule.argument)
+	if err != nil {
+		t.Fatalf("renderedLicenseHeaderLines: %v", err)
+	}
+	licensedFileContents := strings.Join(licenseHeaderLines, "\n") + "\n\npackage main\n"
+
+	cases := []struct {
+		ruleName string
+		rule     rule
+		filePath string
+		contents string
+		want     string
+	}{
+		{
+			ruleName: "DoNothing",
+			filePath: "/virtual/src/Anything.cs",
+			contents: "whatever\n",
+			want:     "",
+		},
+		{
+			ruleName: "NoTabs",
+			filePath: "/virtual/src/Tabs.cs",
+			contents: "line one\n\tline two has a tab\n",
+			want:     "/virtual/src/Tabs.cs:2: Tabs not allowed\n",
+		},
+		{
+			ruleName: "NoLeadingSpaces",
+			filePath: "/virtual/src/Leading.cs",
+			contents: "line one\n  line two has leading spaces\n",
+			want:     "/virtual/src/Leading.cs:2: Leading spaces not allowed\n",
+		},
+		{
+			ruleName: "TabsVsSpacesOnly",
+			filePath: "/virtual/src/Mixed.cs",
+			contents: "  space indent\n\ttab indent\n",
+			want:     "/virtual/src/Mixed.cs:2: Found first tab indent with prior space indents\n",
+		},
+		{
+			ruleName: "ConsistentNewlines",
+			filePath: "/virtual/src/Newlines.cs",
+			contents: "line1\r\nline2\nline3",
+			want:     "/virtual/src/Newlines.cs: File uses inconsistent newlines\n",
+		},
+		{
+			ruleName: "ConsistentIndentWidth",
+			filePath: "/virtual/src/Indent.cs",
+			contents: "     five space indent\n",
+			want:     "/virtual/src/Indent.cs:1: File has first non 4-space indent\n",
+		},
+		{
+			ruleName: "BadNameSpace",
+			filePath: "/virtual/src/Foo/Bar.cs",
+			contents: "namespace Wrong\n{\n}\n",
+			want:     "/virtual/src/Foo/Bar.cs:1: Namespace Wrong is not a suffix of virtual.src.Foo\n",
+		},
+		{
+			ruleName: "BadClassName",
+			filePath: "/virtual/src/Widget.cs",
+			contents: "public class Mismatch\n{\n}\n",
+			want:     "/virtual/src/Widget.cs:1: Class name Mismatch should be Widget instead\n",
+		},
+		{
+			ruleName: "NoMultiplePublicClasses",
+			filePath: "/virtual/src/TwoClasses.cs",
+			contents: "public class First\n{\n}\npublic class Second\n{\n}\n",
+			want:     "/virtual/src/TwoClasses.cs:4: Cannot have multiple public classes per file\n",
+		},
+		{
+			ruleName: "WindowsNewlines",
+			filePath: "/virtual/src/Linux.cs",
+			contents: "line1\nline2\n",
+			want:     "/virtual/src/Linux.cs: File contains non-Windows (Linux) newlines\n",
+		},
+		{
+			ruleName: "LinuxNewlines",
+			filePath: "/virtual/src/Windows.cs",
+			contents: "line1\r\nline2\n",
+			want:     "/virtual/src/Windows.cs: File contains non-Linux (Windows) newlines\n",
+		},
+		{
+			ruleName: "OldMacNewlines",
+			filePath: "/virtual/src/Windows2.cs",
+			contents: "line1\r\nline2\n",
+			want:     "/virtual/src/Windows2.cs: File contains non-Old Mac (Windows) newlines\n",
+		},
+		{
+			ruleName: "NeedSpaceAfterKeyword",
+			filePath: "/virtual/src/Keyword.cs",
+			contents: "void Method()\n{\n    if(x)\n    {\n    }\n}\n",
+			want:     "/virtual/src/Keyword.cs:3: Need space between keyword if and open paren\n",
+		},
+		{
+			ruleName: "LicenseHeader-missing",
+			rule:     licenseRule,
+			filePath: "/virtual/src/unlicensed.go",
+			contents: "package main\n",
+			want:     "/virtual/src/unlicensed.go: Missing or incorrect license header\n",
+		},
+		{
+			ruleName: "LicenseHeader-present",
+			rule:     licenseRule,
+			filePath: licenseFilePath,
+			contents: licensedFileContents,
+			want:     "",
+		},
+		{
+			ruleName: "LicenseHeader-buried",
+			rule:     licenseRule,
+			filePath: "/virtual/src/buried.go",
+			contents: "package foo\n\n" + licensedFileContents,
+			want:     "/virtual/src/buried.go: Missing or incorrect license header\n",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.ruleName, func(t *testing.T) {
+			r := c.rule
+			if r.checkFunc == nil {
+				r = rulesDefinitions[c.ruleName]
+			}
+			got := runRuleCheck(t, r, c.filePath, c.contents)
+			if got != c.want {
+				t.Errorf("%s:\n got:  %q\n want: %q", c.ruleName, got, c.want)
+			}
+		})
+	}
+}
+
+// TestCacheDoesNotLeakPathAcrossIdenticalFiles reproduces a real .git-backed
+// cache hit: two distinct files with identical contents must each report
+// their own Path, not whichever file happened to populate the cache entry
+// first (the cache key is content-addressable and shared between them).
+func TestCacheDoesNotLeakPathAcrossIdenticalFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-sanity-checker-cache-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	fileA := filepath.Join(dir, "dup_a.cs")
+	fileB := filepath.Join(dir, "dup_b.cs")
+	contents := []byte("line one\n\tline two has a tab\n")
+	if err := ioutil.WriteFile(fileA, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(fileB, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	noCacheMode = false
+	defer func() { noCacheMode = true }()
+	defer clearCache()
+
+	rules := []rule{rulesDefinitions["NoTabs"]}
+
+	if _, err := processFile(OsFs{}, rules, fileA, "", nil); err != nil {
+		t.Fatalf("processFile(%q): %v", fileA, err)
+	}
+
+	diagnostics, err := processFile(OsFs{}, rules, fileB, "", nil)
+	if err != nil {
+		t.Fatalf("processFile(%q): %v", fileB, err)
+	}
+	if len(diagnostics) != 1 {
+		t.Fatalf("want 1 diagnostic for %q, got %v", fileB, diagnostics)
+	}
+	if diagnostics[0].Path != fileB {
+		t.Errorf("cached diagnostic leaked path: got %q, want %q", diagnostics[0].Path, fileB)
+	}
+}
+
+// TestCacheDoesNotShareEntryAcrossDifferentRuleSets reproduces a cache
+// collision between two byte-identical files that resolve to different rule
+// sets via an include glob: the cache key has to fold in the resolved rule
+// set, not just the file contents, or whichever file populates the entry
+// first dictates the other's result.
+func TestCacheDoesNotShareEntryAcrossDifferentRuleSets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "git-sanity-checker-cache-ruleset-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	includedDir := filepath.Join(dir, "included")
+	excludedDir := filepath.Join(dir, "excluded")
+	if err := os.MkdirAll(includedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(excludedDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	contents := []byte("line one\n\tline two has a tab\n")
+	includedFile := filepath.Join(includedDir, "a.cs")
+	excludedFile := filepath.Join(excludedDir, "b.cs")
+	if err := ioutil.WriteFile(includedFile, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(excludedFile, contents, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	noCacheMode = false
+	defer func() { noCacheMode = true }()
+	defer clearCache()
+
+	noTabs := cloneRule(rulesDefinitions["NoTabs"])
+	noTabs.includeGlobs = []string{"**/included/**"}
+	rules := []rule{noTabs}
+
+	if _, err := processFile(OsFs{}, rules, includedFile, "", nil); err != nil {
+		t.Fatalf("processFile(%q): %v", includedFile, err)
+	}
+
+	diagnostics, err := processFile(OsFs{}, rules, excludedFile, "", nil)
+	if err != nil {
+		t.Fatalf("processFile(%q): %v", excludedFile, err)
+	}
+	if len(diagnostics) != 0 {
+		t.Errorf("excludedFile should not match NoTabs's include glob, got %v", diagnostics)
+	}
+}